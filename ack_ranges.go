@@ -0,0 +1,185 @@
+package ojnet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	ackRangesBaseLength  = 12
+	ackRangeEntryLength  = 8
+	maxAckRangesPerFrame = 0xFF
+)
+
+// AckRange describes one run of contiguously acknowledged sequence IDs lying
+// below the previous range (or below largestAcked, for the first range).
+// Modeled on QUIC's ACK frame range encoding.
+type AckRange struct {
+	// Gap is the number of un-acknowledged sequence IDs between this range
+	// and the previous one (the one closer to largestAcked).
+	Gap uint32
+	// AckRangeLength is the number of sequence IDs in this range below its
+	// own highest ID, i.e. the run length minus one.
+	AckRangeLength uint32
+}
+
+// ID 0x0D - Range-based counterpart to AcknowledgePacket. Acknowledges a
+// set of sequence IDs made of up to 256 contiguous runs (the first range
+// plus at most 255 further ranges), without the 255-id cap or the
+// 4-bytes-per-id cost of the plain list encoding in AcknowledgePacket.
+type AckRangesPacket struct {
+	largestAcked uint32
+	ackDelay     uint16 // microseconds
+
+	// firstRangeLength is the number of additional acked IDs directly below
+	// largestAcked that belong to the same contiguous run.
+	firstRangeLength uint32
+	ranges           []AckRange
+}
+
+func (packet *AckRangesPacket) Encode() ([]byte, error) {
+	if len(packet.ranges) > maxAckRangesPerFrame {
+		return nil, EncodeDecodeError{"too many ack ranges (max 255)"}
+	}
+
+	buf := bytes.Buffer{}
+	buf.Grow(ackRangesBaseLength + len(packet.ranges)*ackRangeEntryLength)
+
+	buf.WriteByte(byte(AckRangesPid))
+	WriteUInt32(&buf, packet.largestAcked)
+	WriteUInt16(&buf, packet.ackDelay)
+	buf.WriteByte(byte(len(packet.ranges)))
+	WriteUInt32(&buf, packet.firstRangeLength)
+
+	for _, r := range packet.ranges {
+		WriteUInt32(&buf, r.Gap)
+		WriteUInt32(&buf, r.AckRangeLength)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (packet *AckRangesPacket) Decode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+
+	err := checkPidAndLength(buf, AckRangesPid, ackRangesBaseLength, true)
+	if err != nil {
+		return err
+	}
+
+	packet.largestAcked = binary.BigEndian.Uint32(buf.Next(4))
+	packet.ackDelay = binary.BigEndian.Uint16(buf.Next(2))
+
+	rangeCount, _ := buf.ReadByte()
+	packet.firstRangeLength = binary.BigEndian.Uint32(buf.Next(4))
+
+	if packet.firstRangeLength > packet.largestAcked {
+		return EncodeDecodeError{"firstRangeLength exceeds largestAcked"}
+	}
+
+	if buf.Len() != int(rangeCount)*ackRangeEntryLength {
+		return EncodeDecodeError{"Length of buffer does not match range count"}
+	}
+
+	// Validate each range against the same arithmetic Expand() uses to walk
+	// them, so a malformed frame is rejected here instead of underflowing
+	// low/high there and spinning for close to 2^32 iterations.
+	packet.ranges = make([]AckRange, rangeCount)
+	prevLow := packet.largestAcked - packet.firstRangeLength
+	for i := 0; i < int(rangeCount); i++ {
+		gap := binary.BigEndian.Uint32(buf.Next(4))
+		rangeLength := binary.BigEndian.Uint32(buf.Next(4))
+
+		if gap >= prevLow {
+			return EncodeDecodeError{"ack range gap underflows below the previous range"}
+		}
+		high := prevLow - gap - 1
+		if rangeLength > high {
+			return EncodeDecodeError{"ack range length underflows below zero"}
+		}
+
+		packet.ranges[i] = AckRange{Gap: gap, AckRangeLength: rangeLength}
+		prevLow = high - rangeLength
+	}
+
+	return nil
+}
+
+// BuildAckRanges converts a sorted (ascending), duplicate-free list of
+// acknowledged sequence IDs into the compact range representation carried by
+// an AckRangesPacket. It returns nil for an empty ids, since the wire format
+// has no way to distinguish "acking nothing" from "acking sequence ID 0"
+// other than not sending a frame at all.
+func (packet *AcknowledgePacket) BuildAckRanges(ids []uint32, ackDelay uint16) *AckRangesPacket {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	ranges := &AckRangesPacket{ackDelay: ackDelay}
+
+	i := len(ids) - 1
+	ranges.largestAcked = ids[i]
+
+	j := i
+	for j > 0 && ids[j-1] == ids[j]-1 {
+		j--
+	}
+	ranges.firstRangeLength = uint32(i - j)
+
+	prevLow := ids[j]
+	i = j - 1
+
+	for i >= 0 {
+		top := i
+
+		j := i
+		for j > 0 && ids[j-1] == ids[j]-1 {
+			j--
+		}
+
+		ranges.ranges = append(ranges.ranges, AckRange{
+			Gap:            prevLow - ids[top] - 1,
+			AckRangeLength: uint32(top - j),
+		})
+
+		prevLow = ids[j]
+		i = j - 1
+	}
+
+	return ranges
+}
+
+// Expand reconstructs the individual sequence IDs described by the packet's
+// ranges, in ascending order.
+func (packet *AckRangesPacket) Expand() []uint32 {
+	ids := make([]uint32, 0, packet.firstRangeLength+1)
+
+	low := packet.largestAcked - packet.firstRangeLength
+	for id := packet.largestAcked; ; id-- {
+		ids = append(ids, id)
+		if id == low {
+			break
+		}
+	}
+
+	prevLow := low
+	for _, r := range packet.ranges {
+		high := prevLow - r.Gap - 1
+		low := high - r.AckRangeLength
+
+		for id := high; ; id-- {
+			ids = append(ids, id)
+			if id == low {
+				break
+			}
+		}
+
+		prevLow = low
+	}
+
+	for l, r := 0, len(ids)-1; l < r; l, r = l+1, r-1 {
+		ids[l], ids[r] = ids[r], ids[l]
+	}
+
+	return ids
+}
@@ -0,0 +1,115 @@
+package ojnet
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestAckRangesEncodeDecodeRoundTrip(t *testing.T) {
+	ack := &AcknowledgePacket{}
+	original := ack.BuildAckRanges([]uint32{1, 2, 3, 5, 6, 9}, 1500)
+
+	encoded, err := original.Encode()
+	if err != nil {
+		t.Fatalf("Encode() returned error: %v", err)
+	}
+
+	decoded := &AckRangesPacket{}
+	if err := decoded.Decode(encoded); err != nil {
+		t.Fatalf("Decode() returned error: %v", err)
+	}
+
+	got := decoded.Expand()
+	want := []uint32{1, 2, 3, 5, 6, 9}
+
+	if !equalUint32(got, want) {
+		t.Errorf("Expand() = %v, want %v", got, want)
+	}
+}
+
+func TestAckRangesExpandCompressFuzz(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	ack := &AcknowledgePacket{}
+
+	for iteration := 0; iteration < 200; iteration++ {
+		idSet := make(map[uint32]struct{})
+		count := rng.Intn(51) // includes the empty-set case
+
+		for i := 0; i < count; i++ {
+			idSet[uint32(rng.Intn(10000))] = struct{}{}
+		}
+
+		ids := make([]uint32, 0, len(idSet))
+		for id := range idSet {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		ranges := ack.BuildAckRanges(ids, uint16(rng.Intn(65536)))
+
+		if len(ids) == 0 {
+			if ranges != nil {
+				t.Fatalf("iteration %d: BuildAckRanges(nil) = %v, want nil", iteration, ranges)
+			}
+			continue
+		}
+
+		encoded, err := ranges.Encode()
+		if err != nil {
+			t.Fatalf("Encode() returned error: %v", err)
+		}
+
+		decoded := &AckRangesPacket{}
+		if err := decoded.Decode(encoded); err != nil {
+			t.Fatalf("Decode() returned error: %v", err)
+		}
+
+		got := decoded.Expand()
+		if !equalUint32(got, ids) {
+			t.Fatalf("iteration %d: expand(compress(%v)) = %v", iteration, ids, got)
+		}
+	}
+}
+
+func TestAckRangesDecodeRejectsFirstRangeLengthOverflow(t *testing.T) {
+	packet := &AckRangesPacket{largestAcked: 5, firstRangeLength: 10}
+	encoded, err := packet.Encode()
+	if err != nil {
+		t.Fatalf("Encode() returned error: %v", err)
+	}
+
+	decoded := &AckRangesPacket{}
+	if err := decoded.Decode(encoded); err == nil {
+		t.Fatal("expected Decode() to reject firstRangeLength > largestAcked")
+	}
+}
+
+func TestAckRangesDecodeRejectsRangeUnderflow(t *testing.T) {
+	packet := &AckRangesPacket{
+		largestAcked:     100,
+		firstRangeLength: 0,
+		ranges:           []AckRange{{Gap: 1000, AckRangeLength: 0}},
+	}
+	encoded, err := packet.Encode()
+	if err != nil {
+		t.Fatalf("Encode() returned error: %v", err)
+	}
+
+	decoded := &AckRangesPacket{}
+	if err := decoded.Decode(encoded); err == nil {
+		t.Fatal("expected Decode() to reject a range Gap that underflows below the previous range")
+	}
+}
+
+func equalUint32(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
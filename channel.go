@@ -0,0 +1,109 @@
+package ojnet
+
+import "sync"
+
+// Channel holds the per-direction ordering state for one logical channel
+// within a Connection, plus the buffered, in-order delivery queue the
+// application reads from via Connection.Receive.
+type Channel struct {
+	id uint8
+
+	sendLock      sync.Mutex
+	sendOrderedId uint16
+
+	recvLock          sync.Mutex
+	recvNextOrderedId uint16
+	pending           map[uint16]*ContainerPacket
+
+	deliverChan chan []byte
+}
+
+func NewChannel(id uint8) *Channel {
+	return &Channel{
+		id:          id,
+		pending:     make(map[uint16]*ContainerPacket),
+		deliverChan: make(chan []byte, receiveBufferWindow),
+	}
+}
+
+func (ch *Channel) nextSendOrderedId() uint16 {
+	ch.sendLock.Lock()
+	defer ch.sendLock.Unlock()
+
+	id := ch.sendOrderedId
+	ch.sendOrderedId++
+	return id
+}
+
+// resetOrderedIds flushes this channel's ordered state, as triggered by a
+// RESET_ORDERED_IDS channel operation. Both endpoints must apply this at the
+// same logical point in the stream for ordering to stay consistent.
+func (ch *Channel) resetOrderedIds() {
+	ch.sendLock.Lock()
+	ch.sendOrderedId = 0
+	ch.sendLock.Unlock()
+
+	ch.recvLock.Lock()
+	ch.recvNextOrderedId = 0
+	ch.pending = make(map[uint16]*ContainerPacket)
+	ch.recvLock.Unlock()
+}
+
+// orderedIdBefore reports whether a precedes b in the circular orderedId
+// space, correctly handling uint16 wraparound (the usual signed-difference
+// sequence number comparison).
+func orderedIdBefore(a, b uint16) bool {
+	return int16(a-b) < 0
+}
+
+// receive hands an unordered payload straight to the application, or, for
+// ordered payloads, releases them in orderedId order, buffering
+// out-of-order arrivals until the gap preceding them is filled. It is
+// called from Connection.readLoop, so it must never block: enqueue uses a
+// non-blocking send, the same drop-when-full policy already used for
+// ch.pending below.
+func (ch *Channel) receive(packet *ContainerPacket) {
+	if !packet.ordered {
+		ch.enqueue(packet.payload)
+		return
+	}
+
+	ch.recvLock.Lock()
+	defer ch.recvLock.Unlock()
+
+	if orderedIdBefore(packet.orderedId, ch.recvNextOrderedId) {
+		// Already delivered: a stale retransmit of a reliable+ordered
+		// container whose ack was lost. Drop it instead of buffering it
+		// in ch.pending, where it could never be consumed and would sit
+		// there until it crowds out legitimate out-of-order arrivals.
+		return
+	}
+
+	if packet.orderedId != ch.recvNextOrderedId {
+		if len(ch.pending) < receiveBufferWindow {
+			ch.pending[packet.orderedId] = packet
+		}
+		return
+	}
+
+	ch.enqueue(packet.payload)
+	ch.recvNextOrderedId++
+
+	for next, ok := ch.pending[ch.recvNextOrderedId]; ok; next, ok = ch.pending[ch.recvNextOrderedId] {
+		delete(ch.pending, ch.recvNextOrderedId)
+		ch.enqueue(next.payload)
+		ch.recvNextOrderedId++
+	}
+}
+
+// enqueue hands payload to the application-facing deliverChan without
+// blocking. Called from Connection.readLoop, a blocking send here would
+// stall ack generation and every other channel on the connection whenever
+// one application consumer falls behind, so a full deliverChan drops the
+// payload rather than backing up the read loop.
+func (ch *Channel) enqueue(payload []byte) {
+	select {
+	case ch.deliverChan <- payload:
+	default:
+	}
+}
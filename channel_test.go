@@ -0,0 +1,113 @@
+package ojnet
+
+import "testing"
+
+func TestChannelReceiveReleasesInOrder(t *testing.T) {
+	ch := NewChannel(1)
+
+	send := func(orderedId uint16, payload string) {
+		ch.receive(&ContainerPacket{ordered: true, orderedId: orderedId, payload: []byte(payload)})
+	}
+
+	// Arrive out of order: 2, 0, 3, 1
+	send(2, "c")
+	send(0, "a")
+	send(3, "d")
+	send(1, "b")
+
+	want := []string{"a", "b", "c", "d"}
+	for i, expected := range want {
+		select {
+		case got := <-ch.deliverChan:
+			if string(got) != expected {
+				t.Fatalf("delivery %d = %q, want %q", i, got, expected)
+			}
+		default:
+			t.Fatalf("delivery %d missing, want %q", i, expected)
+		}
+	}
+}
+
+func TestChannelReceiveUnorderedBypassesBuffer(t *testing.T) {
+	ch := NewChannel(1)
+	ch.receive(&ContainerPacket{ordered: false, payload: []byte("now")})
+
+	select {
+	case got := <-ch.deliverChan:
+		if string(got) != "now" {
+			t.Fatalf("got %q, want %q", got, "now")
+		}
+	default:
+		t.Fatal("expected unordered payload to be delivered immediately")
+	}
+}
+
+func TestChannelResetOrderedIds(t *testing.T) {
+	ch := NewChannel(1)
+
+	ch.receive(&ContainerPacket{ordered: true, orderedId: 0, payload: []byte("a")})
+	<-ch.deliverChan
+
+	ch.receive(&ContainerPacket{ordered: true, orderedId: 5, payload: []byte("stale")})
+	ch.resetOrderedIds()
+
+	if ch.recvNextOrderedId != 0 {
+		t.Fatalf("recvNextOrderedId = %d, want 0", ch.recvNextOrderedId)
+	}
+	if len(ch.pending) != 0 {
+		t.Fatalf("pending buffer should be cleared after reset, has %d entries", len(ch.pending))
+	}
+
+	ch.receive(&ContainerPacket{ordered: true, orderedId: 0, payload: []byte("restarted")})
+	select {
+	case got := <-ch.deliverChan:
+		if string(got) != "restarted" {
+			t.Fatalf("got %q, want %q", got, "restarted")
+		}
+	default:
+		t.Fatal("expected payload after reset to be delivered")
+	}
+}
+
+func TestChannelReceiveDropsStaleOrderedRetransmit(t *testing.T) {
+	ch := NewChannel(1)
+
+	ch.receive(&ContainerPacket{ordered: true, orderedId: 0, payload: []byte("a")})
+	<-ch.deliverChan
+
+	// A legitimate out-of-order arrival ahead of recvNextOrderedId buffers.
+	ch.receive(&ContainerPacket{ordered: true, orderedId: 2, payload: []byte("c")})
+	if _, pending := ch.pending[2]; !pending {
+		t.Fatal("expected orderedId 2 to be buffered pending orderedId 1")
+	}
+
+	// A retransmit of the already-delivered orderedId 0 must be dropped,
+	// not buffered forever (it can never become the next expected id).
+	ch.receive(&ContainerPacket{ordered: true, orderedId: 0, payload: []byte("stale retransmit")})
+	if _, pending := ch.pending[0]; pending {
+		t.Fatal("stale retransmit of an already-delivered orderedId should not be buffered")
+	}
+	select {
+	case got := <-ch.deliverChan:
+		t.Fatalf("stale retransmit was delivered again: %q", got)
+	default:
+	}
+}
+
+func TestOrderedIdBeforeHandlesWraparound(t *testing.T) {
+	cases := []struct {
+		a, b uint16
+		want bool
+	}{
+		{0, 1, true},
+		{1, 0, false},
+		{65535, 0, true},
+		{0, 65535, false},
+		{5, 5, false},
+	}
+	for _, tc := range cases {
+		if got := orderedIdBefore(tc.a, tc.b); got != tc.want {
+			t.Fatalf("orderedIdBefore(%d, %d) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
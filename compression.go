@@ -0,0 +1,88 @@
+package ojnet
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressor is a pluggable payload codec negotiated between peers at
+// connection handshake time and applied via ContainerPacket's compressed
+// flag.
+type Compressor interface {
+	Compress([]byte) ([]byte, error)
+	Decompress([]byte) ([]byte, error)
+	ID() uint8
+}
+
+const (
+	FlateCompressionID uint8 = 1
+	ZstdCompressionID  uint8 = 2
+
+	// compressionThreshold is the minimum byte reduction a Compressor must
+	// achieve before the compressed flag is set; marginal savings aren't
+	// worth spending a decompression on the peer.
+	compressionThreshold = 16
+)
+
+// FlateCompressor implements Compressor on top of the stdlib DEFLATE codec.
+type FlateCompressor struct{}
+
+func (FlateCompressor) ID() uint8 { return FlateCompressionID }
+
+func (FlateCompressor) Compress(data []byte) ([]byte, error) {
+	buf := bytes.Buffer{}
+	writer, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (FlateCompressor) Decompress(data []byte) ([]byte, error) {
+	reader := flate.NewReader(bytes.NewReader(data))
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// ZstdCompressor implements Compressor using zstandard, trading a larger
+// dependency for a better ratio/speed tradeoff on bigger payloads.
+type ZstdCompressor struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func NewZstdCompressor() (*ZstdCompressor, error) {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ZstdCompressor{encoder: encoder, decoder: decoder}, nil
+}
+
+func (c *ZstdCompressor) ID() uint8 { return ZstdCompressionID }
+
+func (c *ZstdCompressor) Compress(data []byte) ([]byte, error) {
+	return c.encoder.EncodeAll(data, nil), nil
+}
+
+func (c *ZstdCompressor) Decompress(data []byte) ([]byte, error) {
+	return c.decoder.DecodeAll(data, nil)
+}
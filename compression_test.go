@@ -0,0 +1,70 @@
+package ojnet
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFlateCompressorRoundTrip(t *testing.T) {
+	compressor := FlateCompressor{}
+	original := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog "), 20)
+
+	compressed, err := compressor.Compress(original)
+	if err != nil {
+		t.Fatalf("Compress() returned error: %v", err)
+	}
+	if len(compressed) >= len(original) {
+		t.Fatalf("compressed length %d should be smaller than original %d for repetitive input", len(compressed), len(original))
+	}
+
+	decompressed, err := compressor.Decompress(compressed)
+	if err != nil {
+		t.Fatalf("Decompress() returned error: %v", err)
+	}
+	if !bytes.Equal(decompressed, original) {
+		t.Fatal("decompressed payload does not match original")
+	}
+}
+
+func TestConnectionNegotiateCompression(t *testing.T) {
+	conn := &Connection{}
+	conn.RegisterCompressor(FlateCompressor{})
+
+	if err := conn.NegotiateCompression(FlateCompressionID); err != nil {
+		t.Fatalf("NegotiateCompression() returned error for a registered codec: %v", err)
+	}
+	if conn.activeCompressor == nil {
+		t.Fatal("expected activeCompressor to be set after negotiation")
+	}
+
+	if err := conn.NegotiateCompression(ZstdCompressionID); err == nil {
+		t.Fatal("expected NegotiateCompression() to fail for an unregistered codec")
+	}
+
+	if err := conn.NegotiateCompression(0); err != nil {
+		t.Fatalf("NegotiateCompression(0) should always succeed and disable compression: %v", err)
+	}
+	if conn.activeCompressor != nil {
+		t.Fatal("expected activeCompressor to be nil after negotiating CompressionID 0")
+	}
+}
+
+func TestConnectionRequestPacketBackwardCompatibleDecode(t *testing.T) {
+	// A PROTOCOL_VERSION 0 peer's wire format (no CompressionID byte).
+	legacy := &ConnectionRequestPacket{ClientId: 42, ProtocolVersion: 0}
+	buf := bytes.Buffer{}
+	buf.WriteByte(byte(ConnectionRequestPid))
+	WriteUInt64(&buf, legacy.ClientId)
+	buf.WriteByte(legacy.ProtocolVersion)
+
+	decoded := &ConnectionRequestPacket{}
+	if err := decoded.Decode(buf.Bytes()); err != nil {
+		t.Fatalf("Decode() returned error for a legacy (v0) packet: %v", err)
+	}
+	if decoded.ClientId != legacy.ClientId {
+		t.Fatalf("ClientId = %d, want %d", decoded.ClientId, legacy.ClientId)
+	}
+	if decoded.CompressionID != 0 {
+		t.Fatalf("CompressionID = %d, want 0 for a legacy packet", decoded.CompressionID)
+	}
+}
@@ -0,0 +1,419 @@
+package ojnet
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Reliability/ordering subsystem tuning parameters.
+const (
+	initialRTO          = time.Second
+	minRTO              = 200 * time.Millisecond
+	receiveBufferWindow = 256
+
+	maxDatagramSize = 65535 + containerBaseLength + 4
+)
+
+var ErrConnectionClosed = errors.New("ojnet: connection is closed")
+
+// Connection drives the reliability and ordering subsystem described by
+// ContainerPacket, AcknowledgePacket and ChannelOpPacket on top of a single
+// net.PacketConn peer, turning them into the application-facing
+// Send/Receive API.
+type Connection struct {
+	conn net.PacketConn
+
+	peerLock sync.RWMutex
+	peer     net.Addr
+
+	channelsLock sync.Mutex
+	channels     map[uint8]*Channel
+
+	sendWindow *SendWindow
+
+	sequenceLock   sync.Mutex
+	nextSequenceId uint32
+
+	compressorsLock  sync.Mutex
+	compressors      map[uint8]Compressor
+	activeCompressor Compressor
+
+	connIDLock sync.Mutex
+	activeIDs  map[uint64]struct{}
+
+	migrationLock     sync.Mutex
+	pendingChallenges map[string][pathValidationDataLength]byte
+
+	sessionLock sync.Mutex
+	sessionKeys *SessionKeys
+	isClient    bool
+
+	unreliableCounterLock sync.Mutex
+	nextUnreliableCounter uint32
+
+	recvSeqLock sync.Mutex
+	recvSeqSeen map[uint32]struct{}
+
+	closeLock sync.Mutex
+	closed    bool
+}
+
+// NewConnection starts the reliability subsystem for a single peer reachable
+// over conn, spawning the read loop and RTO timer goroutines.
+func NewConnection(conn net.PacketConn, peer net.Addr) *Connection {
+	c := &Connection{
+		conn:              conn,
+		peer:              peer,
+		channels:          make(map[uint8]*Channel),
+		activeIDs:         make(map[uint64]struct{}),
+		pendingChallenges: make(map[string][pathValidationDataLength]byte),
+		recvSeqSeen:       make(map[uint32]struct{}),
+	}
+	c.sendWindow = NewSendWindow(c)
+
+	go c.readLoop()
+	go c.sendWindow.run()
+
+	return c
+}
+
+func (c *Connection) peerAddr() net.Addr {
+	c.peerLock.RLock()
+	defer c.peerLock.RUnlock()
+	return c.peer
+}
+
+func (c *Connection) channel(id uint8) *Channel {
+	c.channelsLock.Lock()
+	defer c.channelsLock.Unlock()
+
+	ch, ok := c.channels[id]
+	if !ok {
+		ch = NewChannel(id)
+		c.channels[id] = ch
+	}
+	return ch
+}
+
+// RegisterCompressor makes compressor available for negotiation via
+// NegotiateCompression. It does not by itself enable compression; the peers
+// must agree on a CompressionID during the handshake first.
+func (c *Connection) RegisterCompressor(compressor Compressor) {
+	c.compressorsLock.Lock()
+	defer c.compressorsLock.Unlock()
+
+	if c.compressors == nil {
+		c.compressors = make(map[uint8]Compressor)
+	}
+	c.compressors[compressor.ID()] = compressor
+}
+
+// NegotiateCompression activates the compressor matching compressionID (as
+// agreed during the ConnectionRequestPacket/ConnectionAcceptedPacket
+// exchange), or disables compression entirely if compressionID is 0. It
+// returns an error if no registered Compressor matches, which callers
+// should surface to the peer as INCOMPATIBLE_COMPRESSION.
+func (c *Connection) NegotiateCompression(compressionID uint8) error {
+	c.compressorsLock.Lock()
+	defer c.compressorsLock.Unlock()
+
+	if compressionID == 0 {
+		c.activeCompressor = nil
+		return nil
+	}
+
+	compressor, ok := c.compressors[compressionID]
+	if !ok {
+		return EncodeDecodeError{"no registered compressor for negotiated CompressionID"}
+	}
+
+	c.activeCompressor = compressor
+	return nil
+}
+
+// tryCompress compresses payload with the negotiated Compressor if one is
+// active and the result is smaller by at least compressionThreshold bytes.
+func (c *Connection) tryCompress(payload []byte) ([]byte, bool) {
+	c.compressorsLock.Lock()
+	compressor := c.activeCompressor
+	c.compressorsLock.Unlock()
+
+	if compressor == nil {
+		return nil, false
+	}
+
+	compressed, err := compressor.Compress(payload)
+	if err != nil || len(compressed) > len(payload)-compressionThreshold {
+		return nil, false
+	}
+
+	return compressed, true
+}
+
+// AddConnectionID marks id as one this connection currently accepts
+// datagrams addressed to, e.g. after issuing or receiving a
+// NewConnectionIdPacket.
+func (c *Connection) AddConnectionID(id uint64) {
+	c.connIDLock.Lock()
+	defer c.connIDLock.Unlock()
+	c.activeIDs[id] = struct{}{}
+}
+
+// RetireConnectionID stops accepting datagrams addressed to id.
+func (c *Connection) RetireConnectionID(id uint64) {
+	c.connIDLock.Lock()
+	defer c.connIDLock.Unlock()
+	delete(c.activeIDs, id)
+}
+
+// OwnsConnectionID reports whether id is currently one of this connection's
+// active connection IDs. Code multiplexing several connections over one
+// socket can use this to route an inbound datagram.
+func (c *Connection) OwnsConnectionID(id uint64) bool {
+	c.connIDLock.Lock()
+	defer c.connIDLock.Unlock()
+	_, ok := c.activeIDs[id]
+	return ok
+}
+
+func (c *Connection) nextSequenceID() uint32 {
+	c.sequenceLock.Lock()
+	defer c.sequenceLock.Unlock()
+
+	id := c.nextSequenceId
+	c.nextSequenceId++
+	return id
+}
+
+// markSequenceSeen records a received reliable sequenceId and reports
+// whether it had already been seen. The sender retransmits a reliable
+// container until it is acked, so the same sequenceId can arrive more than
+// once; without this check a retransmit would be delivered to the
+// application again (unordered) or pile up unconsumed in a Channel's
+// pending buffer forever (ordered, since its orderedId was already
+// released).
+func (c *Connection) markSequenceSeen(sequenceId uint32) bool {
+	c.recvSeqLock.Lock()
+	defer c.recvSeqLock.Unlock()
+
+	if _, seen := c.recvSeqSeen[sequenceId]; seen {
+		return true
+	}
+	c.recvSeqSeen[sequenceId] = struct{}{}
+	return false
+}
+
+// Send transmits payload on the given channel. If reliable is true the
+// container is retransmitted on an RTO-based timer until acknowledged; if
+// ordered is true the receiver releases it to the application in the order
+// it was sent on that channel.
+func (c *Connection) Send(channel uint8, payload []byte, reliable, ordered bool) error {
+	if c.isClosed() {
+		return ErrConnectionClosed
+	}
+
+	ch := c.channel(channel)
+
+	packet := &ContainerPacket{
+		channel:  channel,
+		reliable: reliable,
+		ordered:  ordered,
+		payload:  payload,
+	}
+
+	if compressed, ok := c.tryCompress(payload); ok {
+		packet.compressed = true
+		packet.payload = compressed
+	}
+
+	if reliable {
+		packet.sequenceId = c.nextSequenceID()
+	} else {
+		packet.unreliableCounter = c.nextUnreliableCounterValue()
+	}
+	if ordered {
+		packet.orderedId = ch.nextSendOrderedId()
+	}
+
+	counter := packet.sequenceId
+	if !reliable {
+		counter = packet.unreliableCounter
+	}
+	encrypted, err := c.encryptPayload(packet.payload, reliable, counter)
+	if err != nil {
+		return err
+	}
+	packet.payload = encrypted
+
+	data, err := packet.Encode()
+	if err != nil {
+		return err
+	}
+
+	if reliable {
+		c.sendWindow.track(packet.sequenceId, data)
+	}
+
+	return c.writeToPeer(data)
+}
+
+// Receive returns the channel applications read in-order payloads from.
+func (c *Connection) Receive(channel uint8) <-chan []byte {
+	return c.channel(channel).deliverChan
+}
+
+func (c *Connection) writeToPeer(data []byte) error {
+	_, err := c.conn.WriteTo(data, c.peerAddr())
+	return err
+}
+
+func (c *Connection) readLoop() {
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		data := make([]byte, n)
+		copy(data, buf[:n])
+
+		c.handleDatagram(data, addr)
+	}
+}
+
+// handleDatagram processes one datagram received from fromAddr. fromAddr is
+// not required to match the connection's current peer address: a mismatch
+// only updates the send path once path validation (PathChallengePacket /
+// PathResponsePacket) confirms fromAddr is reachable, so NAT rebinding
+// cannot be used to hijack the connection by spoofing a source address.
+func (c *Connection) handleDatagram(data []byte, fromAddr net.Addr) {
+	if len(data) < 1 {
+		return
+	}
+
+	switch PacketID(data[0]) {
+	case ContainerPid:
+		packet := &ContainerPacket{}
+		if err := packet.Decode(data); err == nil {
+			c.notePeerAddr(fromAddr)
+			c.handleContainer(packet)
+		}
+	case AcknowledgedPid:
+		packet := &AcknowledgePacket{}
+		if err := packet.Decode(data); err == nil {
+			c.notePeerAddr(fromAddr)
+			c.sendWindow.ack(packet.sequenceIds)
+		}
+	case ChannelOperationPid:
+		packet := &ChannelOpPacket{}
+		if err := packet.Decode(data); err == nil {
+			c.notePeerAddr(fromAddr)
+			c.handleChannelOp(packet)
+		}
+	case NewConnectionIdPid:
+		packet := &NewConnectionIdPacket{}
+		if err := packet.Decode(data); err == nil {
+			c.AddConnectionID(packet.connectionId)
+		}
+	case RetireConnectionIdPid:
+		// Acknowledges a connection ID this side already retired; no
+		// further action required.
+	case PathChallengePid:
+		packet := &PathChallengePacket{}
+		if err := packet.Decode(data); err == nil {
+			c.respondToPathChallenge(packet, fromAddr)
+		}
+	case PathResponsePid:
+		packet := &PathResponsePacket{}
+		if err := packet.Decode(data); err == nil {
+			c.handlePathResponse(packet, fromAddr)
+		}
+	}
+}
+
+func (c *Connection) handleContainer(packet *ContainerPacket) {
+	if packet.reliable {
+		c.sendAck(packet.sequenceId)
+		if c.markSequenceSeen(packet.sequenceId) {
+			// Retransmit of a container we already delivered; the ack
+			// above covers the case where the peer's original ack was
+			// lost, but the payload itself must not be delivered twice.
+			return
+		}
+	}
+
+	counter := packet.sequenceId
+	if !packet.reliable {
+		counter = packet.unreliableCounter
+	}
+	payload, err := c.decryptPayload(packet.payload, packet.reliable, counter)
+	if err != nil {
+		return
+	}
+	packet.payload = payload
+
+	if packet.compressed {
+		c.compressorsLock.Lock()
+		compressor := c.activeCompressor
+		c.compressorsLock.Unlock()
+
+		if compressor == nil {
+			return
+		}
+
+		payload, err := compressor.Decompress(packet.payload)
+		if err != nil {
+			return
+		}
+		packet.payload = payload
+	}
+
+	c.channel(packet.channel).receive(packet)
+}
+
+func (c *Connection) sendAck(sequenceId uint32) {
+	ack := &AcknowledgePacket{sequenceIds: []uint32{sequenceId}}
+	data, err := ack.Encode()
+	if err != nil {
+		return
+	}
+
+	c.writeToPeer(data)
+}
+
+func (c *Connection) handleChannelOp(packet *ChannelOpPacket) {
+	switch packet.operation {
+	case RESET_ORDERED_IDS:
+		c.channel(packet.channel).resetOrderedIds()
+	case CLOSE_CHANNEL:
+		if packet.channel == 0 {
+			c.Close()
+		}
+	}
+}
+
+func (c *Connection) isClosed() bool {
+	c.closeLock.Lock()
+	defer c.closeLock.Unlock()
+	return c.closed
+}
+
+// Close tears down the connection: it stops the RTO timer and closes the
+// underlying net.PacketConn. Channels and their delivery queues are left as
+// they are; the queues are not closed.
+func (c *Connection) Close() error {
+	c.closeLock.Lock()
+	defer c.closeLock.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	c.sendWindow.stop()
+
+	return c.conn.Close()
+}
@@ -0,0 +1,157 @@
+package ojnet
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+)
+
+const (
+	newConnectionIdLength    = 17
+	retireConnectionIdLength = 5
+	pathChallengeLength      = 9
+	pathResponseLength       = 9
+
+	pathValidationDataLength = 8
+)
+
+// ConnectionIDGenerator produces new 64-bit connection IDs to issue to a
+// peer via NewConnectionIdPacket. Applications can plug in their own, e.g.
+// to encode routing information for a load balancer in front of several
+// servers.
+type ConnectionIDGenerator interface {
+	GenerateConnectionID() uint64
+}
+
+// RandomConnectionIDGenerator is a ConnectionIDGenerator that produces
+// cryptographically random, unguessable IDs.
+type RandomConnectionIDGenerator struct{}
+
+func (RandomConnectionIDGenerator) GenerateConnectionID() uint64 {
+	var idBytes [8]byte
+	rand.Read(idBytes[:])
+	return binary.BigEndian.Uint64(idBytes[:])
+}
+
+// ID 0x0E - Issues an additional connection ID either side may address
+// datagrams to, modeled on QUIC's NEW_CONNECTION_ID frame. retirePriorTo
+// tells the peer every ID with a lower sequenceNumber is no longer valid.
+type NewConnectionIdPacket struct {
+	connectionId   uint64
+	sequenceNumber uint32
+	retirePriorTo  uint32
+}
+
+func (packet *NewConnectionIdPacket) Encode() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.Grow(newConnectionIdLength)
+
+	buf.WriteByte(byte(NewConnectionIdPid))
+	WriteUInt64(&buf, packet.connectionId)
+	WriteUInt32(&buf, packet.sequenceNumber)
+	WriteUInt32(&buf, packet.retirePriorTo)
+
+	return buf.Bytes(), nil
+}
+
+func (packet *NewConnectionIdPacket) Decode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+
+	err := checkPidAndLength(buf, NewConnectionIdPid, newConnectionIdLength, false)
+	if err != nil {
+		return err
+	}
+
+	packet.connectionId = binary.BigEndian.Uint64(buf.Next(8))
+	packet.sequenceNumber = binary.BigEndian.Uint32(buf.Next(4))
+	packet.retirePriorTo = binary.BigEndian.Uint32(buf.Next(4))
+
+	return nil
+}
+
+// ID 0x0F - Acknowledges that a previously issued connection ID has been
+// retired and must no longer be addressed.
+type RetireConnectionIdPacket struct {
+	sequenceNumber uint32
+}
+
+func (packet *RetireConnectionIdPacket) Encode() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.Grow(retireConnectionIdLength)
+
+	buf.WriteByte(byte(RetireConnectionIdPid))
+	WriteUInt32(&buf, packet.sequenceNumber)
+
+	return buf.Bytes(), nil
+}
+
+func (packet *RetireConnectionIdPacket) Decode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+
+	err := checkPidAndLength(buf, RetireConnectionIdPid, retireConnectionIdLength, false)
+	if err != nil {
+		return err
+	}
+
+	packet.sequenceNumber = binary.BigEndian.Uint32(buf.Next(4))
+
+	return nil
+}
+
+// ID 0x10 - Sent to a candidate new address to confirm it is reachable and
+// controlled by the peer before the send path migrates to it.
+type PathChallengePacket struct {
+	data [pathValidationDataLength]byte
+}
+
+func (packet *PathChallengePacket) Encode() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.Grow(pathChallengeLength)
+
+	buf.WriteByte(byte(PathChallengePid))
+	buf.Write(packet.data[:])
+
+	return buf.Bytes(), nil
+}
+
+func (packet *PathChallengePacket) Decode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+
+	err := checkPidAndLength(buf, PathChallengePid, pathChallengeLength, false)
+	if err != nil {
+		return err
+	}
+
+	copy(packet.data[:], buf.Next(pathValidationDataLength))
+
+	return nil
+}
+
+// ID 0x11 - Echoes a PathChallengePacket's data back to prove the responder
+// controls the address it was sent from.
+type PathResponsePacket struct {
+	data [pathValidationDataLength]byte
+}
+
+func (packet *PathResponsePacket) Encode() ([]byte, error) {
+	buf := bytes.Buffer{}
+	buf.Grow(pathResponseLength)
+
+	buf.WriteByte(byte(PathResponsePid))
+	buf.Write(packet.data[:])
+
+	return buf.Bytes(), nil
+}
+
+func (packet *PathResponsePacket) Decode(data []byte) error {
+	buf := bytes.NewBuffer(data)
+
+	err := checkPidAndLength(buf, PathResponsePid, pathResponseLength, false)
+	if err != nil {
+		return err
+	}
+
+	copy(packet.data[:], buf.Next(pathValidationDataLength))
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package ojnet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHandleContainerDropsRetransmittedReliableUnordered(t *testing.T) {
+	pconn := newFakePacketConn()
+	conn := NewConnection(pconn, fakeAddr("peer:1000"))
+	defer conn.Close()
+
+	packet := &ContainerPacket{channel: 1, reliable: true, sequenceId: 5, payload: []byte("data")}
+	conn.handleContainer(packet)
+	conn.handleContainer(packet) // retransmit: ack was lost, peer resends
+
+	ch := conn.channel(1)
+	select {
+	case <-ch.deliverChan:
+	default:
+		t.Fatal("expected the first delivery to be queued")
+	}
+	select {
+	case got := <-ch.deliverChan:
+		t.Fatalf("retransmit delivered a second payload %q, want it dropped as a duplicate", got)
+	default:
+	}
+}
+
+func TestHandleContainerDropsRetransmittedReliableOrdered(t *testing.T) {
+	pconn := newFakePacketConn()
+	conn := NewConnection(pconn, fakeAddr("peer:1000"))
+	defer conn.Close()
+
+	packet := &ContainerPacket{channel: 1, reliable: true, ordered: true, sequenceId: 5, orderedId: 0, payload: []byte("data")}
+	conn.handleContainer(packet)
+	<-conn.channel(1).deliverChan
+
+	// A later, legitimately out-of-order packet must still buffer normally.
+	future := &ContainerPacket{channel: 1, reliable: true, ordered: true, sequenceId: 6, orderedId: 2, payload: []byte("future")}
+	conn.handleContainer(future)
+
+	// Retransmit of the already-delivered packet (same sequenceId/orderedId).
+	conn.handleContainer(packet)
+
+	ch := conn.channel(1)
+	if _, pending := ch.pending[2]; !pending {
+		t.Fatal("legitimate out-of-order arrival should still be buffered")
+	}
+	select {
+	case got := <-ch.deliverChan:
+		t.Fatalf("retransmit delivered payload %q, want it dropped instead of wedging the pending buffer", got)
+	default:
+	}
+}
+
+func TestHandleContainerReliableUnblocksOnFullDeliverChan(t *testing.T) {
+	pconn := newFakePacketConn()
+	conn := NewConnection(pconn, fakeAddr("peer:1000"))
+	defer conn.Close()
+
+	ch := conn.channel(1)
+	for i := 0; i < cap(ch.deliverChan); i++ {
+		ch.deliverChan <- []byte("filler")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		conn.handleContainer(&ContainerPacket{channel: 1, reliable: true, sequenceId: 99, payload: []byte("overflow")})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handleContainer blocked on a full deliverChan instead of dropping the payload")
+	}
+}
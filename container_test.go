@@ -0,0 +1,86 @@
+package ojnet
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestContainerPacketRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		reliable   bool
+		ordered    bool
+		compressed bool
+		payload    []byte
+	}{
+		{"NoFlagsEmptyPayload", false, false, false, []byte{}},
+		{"NoFlagsWithPayload", false, false, false, []byte("hello")},
+		{"ReliableOnly", true, false, false, []byte("hello")},
+		{"OrderedOnly", false, true, false, []byte("hello")},
+		{"CompressedOnly", false, false, true, []byte("hello")},
+		{"ReliableOrdered", true, true, false, []byte("hello")},
+		{"ReliableCompressed", true, false, true, []byte("hello")},
+		{"OrderedCompressed", false, true, true, []byte("hello")},
+		{"AllFlags", true, true, true, []byte("hello")},
+		{"AllFlagsEmptyPayload", true, true, true, []byte{}},
+		{"AllFlagsMaxPayload", true, true, true, make([]byte, 65535)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			original := &ContainerPacket{
+				channel:           7,
+				reliable:          tc.reliable,
+				ordered:           tc.ordered,
+				compressed:        tc.compressed,
+				sequenceId:        0xDEADBEEF,
+				orderedId:         0xBEEF,
+				unreliableCounter: 0xC0FFEE,
+				payload:           tc.payload,
+			}
+
+			encoded, err := original.Encode()
+			if err != nil {
+				t.Fatalf("Encode() returned error: %v", err)
+			}
+
+			decoded := &ContainerPacket{}
+			if err := decoded.Decode(encoded); err != nil {
+				t.Fatalf("Decode() returned error: %v", err)
+			}
+
+			if decoded.channel != original.channel {
+				t.Errorf("channel = %d, want %d", decoded.channel, original.channel)
+			}
+			if decoded.reliable != original.reliable {
+				t.Errorf("reliable = %v, want %v", decoded.reliable, original.reliable)
+			}
+			if decoded.ordered != original.ordered {
+				t.Errorf("ordered = %v, want %v", decoded.ordered, original.ordered)
+			}
+			if decoded.compressed != original.compressed {
+				t.Errorf("compressed = %v, want %v", decoded.compressed, original.compressed)
+			}
+			if tc.reliable && decoded.sequenceId != original.sequenceId {
+				t.Errorf("sequenceId = %d, want %d", decoded.sequenceId, original.sequenceId)
+			}
+			if !tc.reliable && decoded.unreliableCounter != original.unreliableCounter {
+				t.Errorf("unreliableCounter = %d, want %d", decoded.unreliableCounter, original.unreliableCounter)
+			}
+			if tc.ordered && decoded.orderedId != original.orderedId {
+				t.Errorf("orderedId = %d, want %d", decoded.orderedId, original.orderedId)
+			}
+			if !bytes.Equal(decoded.payload, original.payload) {
+				t.Errorf("payload = %v, want %v", decoded.payload, original.payload)
+			}
+		})
+	}
+}
+
+func TestContainerPacketEncodeRejectsOversizedPayload(t *testing.T) {
+	packet := &ContainerPacket{payload: make([]byte, 0x10000)}
+
+	if _, err := packet.Encode(); err == nil {
+		t.Fatal("expected Encode() to reject a payload larger than 65535 bytes")
+	}
+}
@@ -0,0 +1,119 @@
+package ojnet
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Traffic directions, used to build independent AEAD nonces for each side
+// of the connection so that a client->server datagram can never be replayed
+// back as a valid server->client one.
+const (
+	directionClientToServer byte = 0
+	directionServerToClient byte = 1
+)
+
+// Reliability classes, used as a second domain-separation byte in the AEAD
+// nonce so that the independent sequenceId and unreliableCounter spaces
+// (each restarting at 0 on a fresh connection) can never collide on the same
+// nonce under the same direction.
+const (
+	streamReliable   byte = 0
+	streamUnreliable byte = 1
+)
+
+// sealNonce builds the ChaCha20-Poly1305 nonce for one container: the
+// fixed-size direction byte, a reliability-class byte, and the container's
+// sequenceId (if reliable) or unreliableCounter (if not), which is unique
+// per direction and reliability class for the lifetime of the session.
+func sealNonce(direction byte, reliable bool, counter uint32) [chacha20poly1305.NonceSize]byte {
+	var nonce [chacha20poly1305.NonceSize]byte
+	nonce[0] = direction
+	nonce[1] = streamReliable
+	if !reliable {
+		nonce[1] = streamUnreliable
+	}
+	binary.BigEndian.PutUint32(nonce[len(nonce)-4:], counter)
+	return nonce
+}
+
+// CompleteHandshake activates sessionKeys for all subsequent Send/Receive
+// traffic on this connection. isClient must match the role used to derive
+// sessionKeys (see deriveSessionKeys).
+func (c *Connection) CompleteHandshake(sessionKeys *SessionKeys, isClient bool) {
+	c.sessionLock.Lock()
+	defer c.sessionLock.Unlock()
+
+	c.sessionKeys = sessionKeys
+	c.isClient = isClient
+}
+
+func (c *Connection) outgoingDirection() byte {
+	if c.isClient {
+		return directionClientToServer
+	}
+	return directionServerToClient
+}
+
+func (c *Connection) incomingDirection() byte {
+	if c.isClient {
+		return directionServerToClient
+	}
+	return directionClientToServer
+}
+
+// encryptPayload seals payload under the active session's send key, keyed
+// by reliable and counter (the container's sequenceId or
+// unreliableCounter). It returns payload unchanged if no handshake has
+// completed yet, so an encryption-less Connection (e.g. in tests) keeps
+// working.
+func (c *Connection) encryptPayload(payload []byte, reliable bool, counter uint32) ([]byte, error) {
+	c.sessionLock.Lock()
+	keys := c.sessionKeys
+	direction := c.outgoingDirection()
+	c.sessionLock.Unlock()
+
+	if keys == nil {
+		return payload, nil
+	}
+
+	aead, err := chacha20poly1305.New(keys.sendKey[:])
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := sealNonce(direction, reliable, counter)
+	return aead.Seal(nil, nonce[:], payload, nil), nil
+}
+
+// decryptPayload opens payload sealed by the peer's encryptPayload call for
+// the same reliable and counter. It returns payload unchanged if no
+// handshake has completed yet.
+func (c *Connection) decryptPayload(payload []byte, reliable bool, counter uint32) ([]byte, error) {
+	c.sessionLock.Lock()
+	keys := c.sessionKeys
+	direction := c.incomingDirection()
+	c.sessionLock.Unlock()
+
+	if keys == nil {
+		return payload, nil
+	}
+
+	aead, err := chacha20poly1305.New(keys.recvKey[:])
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := sealNonce(direction, reliable, counter)
+	return aead.Open(nil, nonce[:], payload, nil)
+}
+
+func (c *Connection) nextUnreliableCounterValue() uint32 {
+	c.unreliableCounterLock.Lock()
+	defer c.unreliableCounterLock.Unlock()
+
+	counter := c.nextUnreliableCounter
+	c.nextUnreliableCounter++
+	return counter
+}
@@ -0,0 +1,116 @@
+package ojnet
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func connectedSessionKeys(t *testing.T) (client, server *SessionKeys) {
+	t.Helper()
+
+	clientIdentity, err := GenerateHandshakeIdentity()
+	if err != nil {
+		t.Fatalf("GenerateHandshakeIdentity() returned error: %v", err)
+	}
+	serverIdentity, err := GenerateHandshakeIdentity()
+	if err != nil {
+		t.Fatalf("GenerateHandshakeIdentity() returned error: %v", err)
+	}
+
+	request, ephemeralPrivate, nonce, err := BuildConnectionRequest(1, 0, clientIdentity)
+	if err != nil {
+		t.Fatalf("BuildConnectionRequest() returned error: %v", err)
+	}
+	accepted, serverKeys, err := AcceptConnectionRequest(request, 2, 0, serverIdentity, nil)
+	if err != nil {
+		t.Fatalf("AcceptConnectionRequest() returned error: %v", err)
+	}
+	clientKeys, err := CompleteClientHandshake(accepted, ephemeralPrivate, nonce, nil)
+	if err != nil {
+		t.Fatalf("CompleteClientHandshake() returned error: %v", err)
+	}
+
+	return clientKeys, serverKeys
+}
+
+func TestConnectionEncryptDecryptRoundTrip(t *testing.T) {
+	clientKeys, serverKeys := connectedSessionKeys(t)
+
+	client := &Connection{sessionKeys: clientKeys, isClient: true}
+	server := &Connection{sessionKeys: serverKeys, isClient: false}
+
+	plaintext := []byte("hello over an encrypted channel")
+
+	sealed, err := client.encryptPayload(plaintext, true, 7)
+	if err != nil {
+		t.Fatalf("encryptPayload() returned error: %v", err)
+	}
+	if string(sealed) == string(plaintext) {
+		t.Fatal("encryptPayload() did not transform the plaintext")
+	}
+
+	opened, err := server.decryptPayload(sealed, true, 7)
+	if err != nil {
+		t.Fatalf("decryptPayload() returned error: %v", err)
+	}
+	if string(opened) != string(plaintext) {
+		t.Fatalf("decryptPayload() = %q, want %q", opened, plaintext)
+	}
+}
+
+func TestConnectionDecryptRejectsWrongCounter(t *testing.T) {
+	clientKeys, serverKeys := connectedSessionKeys(t)
+
+	client := &Connection{sessionKeys: clientKeys, isClient: true}
+	server := &Connection{sessionKeys: serverKeys, isClient: false}
+
+	sealed, err := client.encryptPayload([]byte("payload"), true, 1)
+	if err != nil {
+		t.Fatalf("encryptPayload() returned error: %v", err)
+	}
+
+	if _, err := server.decryptPayload(sealed, true, 2); err == nil {
+		t.Fatal("expected decryptPayload() to fail when the nonce counter does not match")
+	}
+}
+
+func TestConnectionReliableAndUnreliableNoncesNeverCollide(t *testing.T) {
+	clientKeys, _ := connectedSessionKeys(t)
+	client := &Connection{sessionKeys: clientKeys, isClient: true}
+
+	seen := make(map[[chacha20poly1305.NonceSize]byte]bool)
+	for counter := uint32(0); counter < 16; counter++ {
+		for _, reliable := range []bool{true, false} {
+			nonce := sealNonce(client.outgoingDirection(), reliable, counter)
+			if seen[nonce] {
+				t.Fatalf("nonce collision for reliable=%v counter=%d", reliable, counter)
+			}
+			seen[nonce] = true
+		}
+	}
+}
+
+func TestConnectionEncryptPayloadPassthroughWithoutHandshake(t *testing.T) {
+	conn := &Connection{}
+
+	plaintext := []byte("unencrypted")
+	sealed, err := conn.encryptPayload(plaintext, true, 0)
+	if err != nil {
+		t.Fatalf("encryptPayload() returned error: %v", err)
+	}
+	if string(sealed) != string(plaintext) {
+		t.Fatal("expected encryptPayload() to pass payload through unchanged before a handshake completes")
+	}
+}
+
+func TestConnectionNextUnreliableCounterValueIncrements(t *testing.T) {
+	conn := &Connection{}
+
+	if v := conn.nextUnreliableCounterValue(); v != 0 {
+		t.Fatalf("first nextUnreliableCounterValue() = %d, want 0", v)
+	}
+	if v := conn.nextUnreliableCounterValue(); v != 1 {
+		t.Fatalf("second nextUnreliableCounterValue() = %d, want 1", v)
+	}
+}
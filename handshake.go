@@ -0,0 +1,228 @@
+package ojnet
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	x25519KeySize        = 32
+	ed25519PublicKeySize = ed25519.PublicKeySize
+	ed25519SignatureSize = ed25519.SignatureSize
+	handshakeNonceSize   = 16
+
+	handshakeHKDFInfo = "ojnet handshake v1"
+)
+
+var (
+	ErrUnauthorizedIdentity      = errors.New("ojnet: peer identity not authorized")
+	ErrHandshakeSignatureInvalid = errors.New("ojnet: handshake signature verification failed")
+)
+
+// ContactManager lets an application decide which long-term peer identities
+// are allowed to complete the handshake, independent of whether the
+// cryptographic signature itself is valid.
+type ContactManager interface {
+	LookupPeer(pubkey ed25519.PublicKey) (allowed bool)
+}
+
+// HandshakeIdentity is a long-term Ed25519 keypair used to authenticate this
+// endpoint to its peer during the handshake.
+type HandshakeIdentity struct {
+	PublicKey  ed25519.PublicKey
+	PrivateKey ed25519.PrivateKey
+}
+
+func GenerateHandshakeIdentity() (*HandshakeIdentity, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &HandshakeIdentity{PublicKey: public, PrivateKey: private}, nil
+}
+
+// ephemeralKeyPair is a single-use X25519 keypair generated fresh for every
+// handshake attempt.
+type ephemeralKeyPair struct {
+	private [x25519KeySize]byte
+	public  [x25519KeySize]byte
+}
+
+func generateEphemeralKeyPair() (*ephemeralKeyPair, error) {
+	pair := &ephemeralKeyPair{}
+	if _, err := io.ReadFull(rand.Reader, pair.private[:]); err != nil {
+		return nil, err
+	}
+
+	public, err := curve25519.X25519(pair.private[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	copy(pair.public[:], public)
+
+	return pair, nil
+}
+
+func handshakeSignedMessage(ephemeralKey [x25519KeySize]byte, nonce [handshakeNonceSize]byte) []byte {
+	message := make([]byte, 0, x25519KeySize+handshakeNonceSize)
+	message = append(message, ephemeralKey[:]...)
+	message = append(message, nonce[:]...)
+	return message
+}
+
+// signHandshake authenticates ephemeralKey + nonce with identity's long-term
+// private key, binding the signature to this specific handshake attempt.
+func signHandshake(identity *HandshakeIdentity, ephemeralKey [x25519KeySize]byte, nonce [handshakeNonceSize]byte) [ed25519SignatureSize]byte {
+	var signature [ed25519SignatureSize]byte
+	copy(signature[:], ed25519.Sign(identity.PrivateKey, handshakeSignedMessage(ephemeralKey, nonce)))
+	return signature
+}
+
+func verifyHandshakeSignature(identityKey [ed25519PublicKeySize]byte, ephemeralKey [x25519KeySize]byte, nonce [handshakeNonceSize]byte, signature [ed25519SignatureSize]byte) bool {
+	key := make(ed25519.PublicKey, ed25519PublicKeySize)
+	copy(key, identityKey[:])
+	return ed25519.Verify(key, handshakeSignedMessage(ephemeralKey, nonce), signature[:])
+}
+
+// SessionKeys holds the two independent ChaCha20-Poly1305 keys derived from
+// a completed handshake, one per direction, so that compromising one
+// direction's key can't be used to forge traffic in the other.
+type SessionKeys struct {
+	sendKey [chacha20poly1305.KeySize]byte
+	recvKey [chacha20poly1305.KeySize]byte
+}
+
+// deriveSessionKeys runs HKDF-SHA256 over the X25519 shared secret and
+// splits its output into the client->server and server->client AEAD keys,
+// returned arranged from isClient's point of view.
+func deriveSessionKeys(sharedSecret [x25519KeySize]byte, isClient bool) (*SessionKeys, error) {
+	reader := hkdf.New(sha256.New, sharedSecret[:], nil, []byte(handshakeHKDFInfo))
+
+	var clientToServer, serverToClient [chacha20poly1305.KeySize]byte
+	if _, err := io.ReadFull(reader, clientToServer[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(reader, serverToClient[:]); err != nil {
+		return nil, err
+	}
+
+	if isClient {
+		return &SessionKeys{sendKey: clientToServer, recvKey: serverToClient}, nil
+	}
+	return &SessionKeys{sendKey: serverToClient, recvKey: clientToServer}, nil
+}
+
+func computeSharedSecret(ourPrivate, theirPublic [x25519KeySize]byte) ([x25519KeySize]byte, error) {
+	var secret [x25519KeySize]byte
+
+	shared, err := curve25519.X25519(ourPrivate[:], theirPublic[:])
+	if err != nil {
+		return secret, err
+	}
+	copy(secret[:], shared)
+
+	return secret, nil
+}
+
+// BuildConnectionRequest generates a fresh ephemeral keypair and nonce and
+// produces a ConnectionRequestPacket signed by identity. The caller must
+// hold onto the returned ephemeral private key and nonce to complete the
+// handshake once a ConnectionAcceptedPacket arrives.
+func BuildConnectionRequest(clientId uint64, compressionID uint8, identity *HandshakeIdentity) (packet *ConnectionRequestPacket, ephemeralPrivate [x25519KeySize]byte, nonce [handshakeNonceSize]byte, err error) {
+	ephemeral, err := generateEphemeralKeyPair()
+	if err != nil {
+		return nil, ephemeralPrivate, nonce, err
+	}
+
+	if _, err = io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, ephemeralPrivate, nonce, err
+	}
+
+	packet = &ConnectionRequestPacket{
+		ClientId:        clientId,
+		ProtocolVersion: PROTOCOL_VERSION,
+		CompressionID:   compressionID,
+		EphemeralKey:    ephemeral.public,
+		Nonce:           nonce,
+	}
+	copy(packet.IdentityKey[:], identity.PublicKey)
+	packet.Signature = signHandshake(identity, packet.EphemeralKey, packet.Nonce)
+
+	return packet, ephemeral.private, nonce, nil
+}
+
+// AcceptConnectionRequest verifies request's handshake signature and checks
+// the claimed identity against contacts (nil allows any identity), then
+// builds the matching ConnectionAcceptedPacket and the resulting
+// server-side SessionKeys. Callers should surface ErrUnauthorizedIdentity to
+// the client as an UNAUTHORIZED_IDENTITY ConnectionRejectedPacket.
+func AcceptConnectionRequest(request *ConnectionRequestPacket, serverId uint64, compressionID uint8, identity *HandshakeIdentity, contacts ContactManager) (*ConnectionAcceptedPacket, *SessionKeys, error) {
+	if !verifyHandshakeSignature(request.IdentityKey, request.EphemeralKey, request.Nonce, request.Signature) {
+		return nil, nil, ErrHandshakeSignatureInvalid
+	}
+
+	if contacts != nil {
+		key := make(ed25519.PublicKey, ed25519PublicKeySize)
+		copy(key, request.IdentityKey[:])
+		if !contacts.LookupPeer(key) {
+			return nil, nil, ErrUnauthorizedIdentity
+		}
+	}
+
+	ephemeral, err := generateEphemeralKeyPair()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sharedSecret, err := computeSharedSecret(ephemeral.private, request.EphemeralKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys, err := deriveSessionKeys(sharedSecret, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	accepted := &ConnectionAcceptedPacket{
+		ServerId:      serverId,
+		CompressionID: compressionID,
+		EphemeralKey:  ephemeral.public,
+	}
+	copy(accepted.IdentityKey[:], identity.PublicKey)
+	accepted.Signature = signHandshake(identity, accepted.EphemeralKey, request.Nonce)
+
+	return accepted, keys, nil
+}
+
+// CompleteClientHandshake verifies a ConnectionAcceptedPacket's signature
+// and identity (against contacts, nil allows any identity), then derives
+// the client-side SessionKeys from ourEphemeralPrivate (as returned by
+// BuildConnectionRequest) and the server's ephemeral public key.
+func CompleteClientHandshake(accepted *ConnectionAcceptedPacket, ourEphemeralPrivate [x25519KeySize]byte, sentNonce [handshakeNonceSize]byte, contacts ContactManager) (*SessionKeys, error) {
+	if !verifyHandshakeSignature(accepted.IdentityKey, accepted.EphemeralKey, sentNonce, accepted.Signature) {
+		return nil, ErrHandshakeSignatureInvalid
+	}
+
+	if contacts != nil {
+		key := make(ed25519.PublicKey, ed25519PublicKeySize)
+		copy(key, accepted.IdentityKey[:])
+		if !contacts.LookupPeer(key) {
+			return nil, ErrUnauthorizedIdentity
+		}
+	}
+
+	sharedSecret, err := computeSharedSecret(ourEphemeralPrivate, accepted.EphemeralKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return deriveSessionKeys(sharedSecret, true)
+}
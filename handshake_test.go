@@ -0,0 +1,85 @@
+package ojnet
+
+import (
+	"crypto/ed25519"
+	"testing"
+)
+
+type stubContactManager struct {
+	allowed map[string]bool
+}
+
+func (m stubContactManager) LookupPeer(pubkey ed25519.PublicKey) bool {
+	return m.allowed[string(pubkey)]
+}
+
+func TestHandshakeRoundTrip(t *testing.T) {
+	clientIdentity, err := GenerateHandshakeIdentity()
+	if err != nil {
+		t.Fatalf("GenerateHandshakeIdentity() returned error: %v", err)
+	}
+	serverIdentity, err := GenerateHandshakeIdentity()
+	if err != nil {
+		t.Fatalf("GenerateHandshakeIdentity() returned error: %v", err)
+	}
+
+	request, ephemeralPrivate, nonce, err := BuildConnectionRequest(1, FlateCompressionID, clientIdentity)
+	if err != nil {
+		t.Fatalf("BuildConnectionRequest() returned error: %v", err)
+	}
+
+	accepted, serverKeys, err := AcceptConnectionRequest(request, 2, FlateCompressionID, serverIdentity, nil)
+	if err != nil {
+		t.Fatalf("AcceptConnectionRequest() returned error: %v", err)
+	}
+
+	clientKeys, err := CompleteClientHandshake(accepted, ephemeralPrivate, nonce, nil)
+	if err != nil {
+		t.Fatalf("CompleteClientHandshake() returned error: %v", err)
+	}
+
+	if clientKeys.sendKey != serverKeys.recvKey {
+		t.Error("client send key does not match server recv key")
+	}
+	if clientKeys.recvKey != serverKeys.sendKey {
+		t.Error("client recv key does not match server send key")
+	}
+	if clientKeys.sendKey == clientKeys.recvKey {
+		t.Error("expected distinct send/recv keys per direction")
+	}
+}
+
+func TestAcceptConnectionRequestRejectsBadSignature(t *testing.T) {
+	clientIdentity, _ := GenerateHandshakeIdentity()
+	serverIdentity, _ := GenerateHandshakeIdentity()
+
+	request, _, _, err := BuildConnectionRequest(1, 0, clientIdentity)
+	if err != nil {
+		t.Fatalf("BuildConnectionRequest() returned error: %v", err)
+	}
+	request.Nonce[0] ^= 0xFF // invalidates the signature
+
+	if _, _, err := AcceptConnectionRequest(request, 2, 0, serverIdentity, nil); err != ErrHandshakeSignatureInvalid {
+		t.Fatalf("AcceptConnectionRequest() error = %v, want ErrHandshakeSignatureInvalid", err)
+	}
+}
+
+func TestAcceptConnectionRequestEnforcesContactManager(t *testing.T) {
+	clientIdentity, _ := GenerateHandshakeIdentity()
+	serverIdentity, _ := GenerateHandshakeIdentity()
+
+	request, _, _, err := BuildConnectionRequest(1, 0, clientIdentity)
+	if err != nil {
+		t.Fatalf("BuildConnectionRequest() returned error: %v", err)
+	}
+
+	contacts := stubContactManager{allowed: map[string]bool{}}
+	if _, _, err := AcceptConnectionRequest(request, 2, 0, serverIdentity, contacts); err != ErrUnauthorizedIdentity {
+		t.Fatalf("AcceptConnectionRequest() error = %v, want ErrUnauthorizedIdentity", err)
+	}
+
+	contacts.allowed[string(clientIdentity.PublicKey)] = true
+	if _, _, err := AcceptConnectionRequest(request, 2, 0, serverIdentity, contacts); err != nil {
+		t.Fatalf("AcceptConnectionRequest() returned error for an allowed contact: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package ojnet
+
+import (
+	"crypto/rand"
+	"net"
+)
+
+// notePeerAddr is called whenever a datagram carrying application or control
+// data arrives. If it comes from the address the connection already trusts,
+// nothing happens; if it comes from a new address, path validation begins
+// before the send path is allowed to switch (as after a NAT rebinding).
+func (c *Connection) notePeerAddr(fromAddr net.Addr) {
+	current := c.peerAddr()
+	if current == nil {
+		c.peerLock.Lock()
+		c.peer = fromAddr
+		c.peerLock.Unlock()
+		return
+	}
+
+	if fromAddr.String() == current.String() {
+		return
+	}
+
+	c.beginPathValidation(fromAddr)
+}
+
+// beginPathValidation sends a PathChallengePacket to candidate and remembers
+// the token so a matching PathResponsePacket can later confirm the address
+// is reachable and controlled by the peer.
+func (c *Connection) beginPathValidation(candidate net.Addr) {
+	c.migrationLock.Lock()
+	if _, inProgress := c.pendingChallenges[candidate.String()]; inProgress {
+		c.migrationLock.Unlock()
+		return
+	}
+
+	var token [pathValidationDataLength]byte
+	rand.Read(token[:])
+	c.pendingChallenges[candidate.String()] = token
+	c.migrationLock.Unlock()
+
+	packet := &PathChallengePacket{data: token}
+	data, err := packet.Encode()
+	if err != nil {
+		return
+	}
+
+	c.conn.WriteTo(data, candidate)
+}
+
+// respondToPathChallenge echoes the challenge data back to fromAddr so the
+// side validating that path can confirm it reached the right peer.
+func (c *Connection) respondToPathChallenge(packet *PathChallengePacket, fromAddr net.Addr) {
+	response := &PathResponsePacket{data: packet.data}
+	data, err := response.Encode()
+	if err != nil {
+		return
+	}
+
+	c.conn.WriteTo(data, fromAddr)
+}
+
+// handlePathResponse switches the send path to fromAddr once its response
+// token matches the outstanding challenge for that address.
+func (c *Connection) handlePathResponse(packet *PathResponsePacket, fromAddr net.Addr) {
+	c.migrationLock.Lock()
+	expected, ok := c.pendingChallenges[fromAddr.String()]
+	if ok && expected == packet.data {
+		delete(c.pendingChallenges, fromAddr.String())
+	} else {
+		ok = false
+	}
+	c.migrationLock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	c.peerLock.Lock()
+	c.peer = fromAddr
+	c.peerLock.Unlock()
+}
@@ -0,0 +1,138 @@
+package ojnet
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type fakeAddr string
+
+func (a fakeAddr) Network() string { return "fake" }
+func (a fakeAddr) String() string  { return string(a) }
+
+type writtenPacket struct {
+	data []byte
+	addr net.Addr
+}
+
+// fakePacketConn is a net.PacketConn whose ReadFrom blocks until Close, so
+// tests can drive Connection's handlers directly without real sockets while
+// still exercising the readLoop/Close lifecycle.
+type fakePacketConn struct {
+	writes    chan writtenPacket
+	closeChan chan struct{}
+}
+
+func newFakePacketConn() *fakePacketConn {
+	return &fakePacketConn{writes: make(chan writtenPacket, 16), closeChan: make(chan struct{})}
+}
+
+func (f *fakePacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	<-f.closeChan
+	return 0, nil, io.EOF
+}
+
+func (f *fakePacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	data := make([]byte, len(p))
+	copy(data, p)
+	f.writes <- writtenPacket{data: data, addr: addr}
+	return len(p), nil
+}
+
+func (f *fakePacketConn) Close() error {
+	select {
+	case <-f.closeChan:
+	default:
+		close(f.closeChan)
+	}
+	return nil
+}
+
+func (f *fakePacketConn) LocalAddr() net.Addr                { return fakeAddr("local") }
+func (f *fakePacketConn) SetDeadline(t time.Time) error      { return nil }
+func (f *fakePacketConn) SetReadDeadline(t time.Time) error  { return nil }
+func (f *fakePacketConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func TestConnectionMigrationRequiresPathValidation(t *testing.T) {
+	pconn := newFakePacketConn()
+	originalPeer := fakeAddr("peer-original:1000")
+	conn := NewConnection(pconn, originalPeer)
+	defer conn.Close()
+
+	newAddr := fakeAddr("peer-new:2000")
+
+	container := &ContainerPacket{channel: 1, payload: []byte("hi")}
+	data, err := container.Encode()
+	if err != nil {
+		t.Fatalf("Encode() returned error: %v", err)
+	}
+
+	// Simulate a datagram arriving from a new address (NAT rebinding): the
+	// send path must not switch until that address is validated.
+	conn.handleDatagram(data, newAddr)
+
+	if conn.peerAddr().String() != originalPeer.String() {
+		t.Fatalf("peer switched to %v before path validation completed", conn.peerAddr())
+	}
+
+	var challenge writtenPacket
+	select {
+	case challenge = <-pconn.writes:
+	case <-time.After(time.Second):
+		t.Fatal("expected a PathChallengePacket to be sent to the new address")
+	}
+	if challenge.addr.String() != newAddr.String() {
+		t.Fatalf("challenge sent to %v, want %v", challenge.addr, newAddr)
+	}
+
+	decodedChallenge := &PathChallengePacket{}
+	if err := decodedChallenge.Decode(challenge.data); err != nil {
+		t.Fatalf("failed to decode challenge: %v", err)
+	}
+
+	// Respond as the new address would, echoing the challenge data back.
+	response := &PathResponsePacket{data: decodedChallenge.data}
+	responseData, err := response.Encode()
+	if err != nil {
+		t.Fatalf("Encode() returned error: %v", err)
+	}
+	conn.handleDatagram(responseData, newAddr)
+
+	if conn.peerAddr().String() != newAddr.String() {
+		t.Fatalf("peer = %v after valid path response, want %v", conn.peerAddr(), newAddr)
+	}
+}
+
+func TestConnectionMigrationRejectsMismatchedResponse(t *testing.T) {
+	pconn := newFakePacketConn()
+	originalPeer := fakeAddr("peer-original:1000")
+	conn := NewConnection(pconn, originalPeer)
+	defer conn.Close()
+
+	newAddr := fakeAddr("peer-new:2000")
+	conn.beginPathValidation(newAddr)
+	<-pconn.writes // drain the challenge
+
+	wrongResponse := &PathResponsePacket{data: [pathValidationDataLength]byte{1, 2, 3, 4, 5, 6, 7, 8}}
+	conn.handlePathResponse(wrongResponse, newAddr)
+
+	if conn.peerAddr().String() != originalPeer.String() {
+		t.Fatal("peer switched on a mismatched path response token")
+	}
+}
+
+func TestConnectionIDTracking(t *testing.T) {
+	conn := &Connection{activeIDs: make(map[uint64]struct{})}
+
+	conn.AddConnectionID(42)
+	if !conn.OwnsConnectionID(42) {
+		t.Fatal("expected connection to own ID 42 after AddConnectionID")
+	}
+
+	conn.RetireConnectionID(42)
+	if conn.OwnsConnectionID(42) {
+		t.Fatal("expected connection to no longer own ID 42 after RetireConnectionID")
+	}
+}
@@ -34,7 +34,11 @@ func checkPidAndLength(buf *bytes.Buffer, expectedId PacketID, expectedLength in
 	return nil
 }
 
-const PROTOCOL_VERSION uint8 = 0
+// PROTOCOL_VERSION 1 added CompressionID to ConnectionRequestPacket and
+// ConnectionAcceptedPacket. PROTOCOL_VERSION 2 added the mutual X25519/
+// Ed25519 handshake fields. Decode still accepts earlier peers that omit
+// fields added by a later version.
+const PROTOCOL_VERSION uint8 = 2
 
 type PacketID uint8
 
@@ -45,22 +49,84 @@ const (
 	AcknowledgedPid     PacketID = 0x0A
 	ChannelOperationPid PacketID = 0x0B
 	ContainerPid        PacketID = 0x0C
+	AckRangesPid        PacketID = 0x0D
+
+	NewConnectionIdPid    PacketID = 0x0E
+	RetireConnectionIdPid PacketID = 0x0F
+	PathChallengePid      PacketID = 0x10
+	PathResponsePid       PacketID = 0x11
 )
 
 const (
-	connectionRequestLength  = 10
-	connectionAcceptedLength = 9
+	// connectionRequestLengthV0/connectionAcceptedLengthV0 are the pre-
+	// compression-negotiation lengths, still accepted on Decode for
+	// backward compatibility with PROTOCOL_VERSION 0 peers.
+	connectionRequestLengthV0 = 10
+	connectionRequestLengthV1 = 11
+	// connectionRequestLength (PROTOCOL_VERSION 2) adds the X25519
+	// ephemeral key, Ed25519 identity key, client nonce and signature
+	// used by the mutual handshake.
+	connectionRequestLength = connectionRequestLengthV1 +
+		x25519KeySize + ed25519PublicKeySize + handshakeNonceSize + ed25519SignatureSize
+
+	connectionAcceptedLengthV0 = 9
+	connectionAcceptedLengthV1 = 10
+	// connectionAcceptedLength (PROTOCOL_VERSION 2) adds the server's
+	// ephemeral key, identity key and signature.
+	connectionAcceptedLength = connectionAcceptedLengthV1 +
+		x25519KeySize + ed25519PublicKeySize + ed25519SignatureSize
+
 	connectionRejectedLength = 2
 	channelOperationLength   = 3
 
 	acknowledgedBaseLength = 6
-	containerBaseLength    = 4
+	// containerBaseLength includes the 4-byte counter (sequenceId or
+	// unreliableCounter) every container carries: pid + flags + channel +
+	// counter + payload length prefix.
+	containerBaseLength = 9
+
+	containerReliableFlag   = 0x1
+	containerOrderedFlag    = 0x2
+	containerCompressedFlag = 0x4
 )
 
+// containerExpectedLength computes the minimum number of bytes a ContainerPacket
+// must have (excluding the payload itself) given its flag byte. Every
+// container carries a 4-byte counter regardless of flags - sequenceId when
+// reliable, unreliableCounter otherwise - so it's part of containerBaseLength.
+func containerExpectedLength(flags byte) int {
+	length := containerBaseLength
+
+	if flags&containerOrderedFlag != 0 {
+		length += 2
+	}
+
+	return length
+}
+
 // ID: 0x01 - Send from client to server to try to open a connection
 type ConnectionRequestPacket struct {
 	ClientId        uint64
 	ProtocolVersion uint8
+
+	// CompressionID is the Compressor the client prefers to use, or 0 for
+	// none. Absent on PROTOCOL_VERSION 0 peers.
+	CompressionID uint8
+
+	// Handshake fields, absent on PROTOCOL_VERSION < 2 peers. EphemeralKey
+	// is an X25519 public key used to derive the session's AEAD keys.
+	// IdentityKey is the client's long-term Ed25519 public key, and
+	// Signature authenticates it: ed25519.Sign(identityPrivateKey,
+	// EphemeralKey || Nonce). Nonce is client-chosen rather than
+	// server-supplied, trading the stronger freshness guarantee a
+	// server-issued challenge would give for a single round trip; each
+	// attempt still derives an independent session key from its own
+	// ephemeral key, so a replayed signature can't be used to recover a
+	// past session.
+	EphemeralKey [x25519KeySize]byte
+	IdentityKey  [ed25519PublicKeySize]byte
+	Nonce        [handshakeNonceSize]byte
+	Signature    [ed25519SignatureSize]byte
 }
 
 func (packet *ConnectionRequestPacket) Encode() ([]byte, error) {
@@ -70,21 +136,41 @@ func (packet *ConnectionRequestPacket) Encode() ([]byte, error) {
 
 	WriteUInt64(&buf, packet.ClientId)
 	buf.WriteByte(packet.ProtocolVersion)
+	buf.WriteByte(packet.CompressionID)
+	buf.Write(packet.EphemeralKey[:])
+	buf.Write(packet.IdentityKey[:])
+	buf.Write(packet.Nonce[:])
+	buf.Write(packet.Signature[:])
 	return buf.Bytes(), nil
 }
 
 func (packet *ConnectionRequestPacket) Decode(data []byte) error {
 	buf := bytes.NewBuffer(data)
 
-	err := checkPidAndLength(buf, ConnectionRequestPid, connectionRequestLength, false)
+	err := checkPidAndLength(buf, ConnectionRequestPid, connectionRequestLengthV0, true)
 	if err != nil {
 		return err
 	}
 
-	clientIdBytes, _ := buf.ReadBytes(8)
-	packet.ClientId = binary.BigEndian.Uint64(clientIdBytes)
-	pVer, _ := buf.ReadByte()
-	packet.ProtocolVersion = pVer
+	packet.ClientId = binary.BigEndian.Uint64(buf.Next(8))
+	packet.ProtocolVersion, _ = buf.ReadByte()
+
+	if buf.Len() == 0 {
+		return nil
+	}
+	packet.CompressionID, _ = buf.ReadByte()
+
+	if buf.Len() == 0 {
+		return nil
+	}
+	if buf.Len() < connectionRequestLength-connectionRequestLengthV1 {
+		return EncodeDecodeError{"incomplete handshake fields in ConnectionRequestPacket"}
+	}
+
+	copy(packet.EphemeralKey[:], buf.Next(x25519KeySize))
+	copy(packet.IdentityKey[:], buf.Next(ed25519PublicKeySize))
+	copy(packet.Nonce[:], buf.Next(handshakeNonceSize))
+	copy(packet.Signature[:], buf.Next(ed25519SignatureSize))
 
 	return nil
 }
@@ -92,27 +178,57 @@ func (packet *ConnectionRequestPacket) Decode(data []byte) error {
 // ID 0x02 - Response from server to accept and open a connection
 type ConnectionAcceptedPacket struct {
 	ServerId uint64
+
+	// CompressionID is the Compressor the server chose to use, or 0 for
+	// none. Absent on PROTOCOL_VERSION 0 peers.
+	CompressionID uint8
+
+	// Handshake fields, absent on PROTOCOL_VERSION < 2 peers. Signature
+	// authenticates EphemeralKey by covering EphemeralKey || the client's
+	// Nonce from the ConnectionRequestPacket being answered.
+	EphemeralKey [x25519KeySize]byte
+	IdentityKey  [ed25519PublicKeySize]byte
+	Signature    [ed25519SignatureSize]byte
 }
 
 func (packet *ConnectionAcceptedPacket) Encode() ([]byte, error) {
 	buf := bytes.Buffer{}
-	buf.Grow(connectionRejectedLength)
+	buf.Grow(connectionAcceptedLength)
 	buf.WriteByte(byte(ConnectionAcceptedPid))
 
 	WriteUInt64(&buf, packet.ServerId)
+	buf.WriteByte(packet.CompressionID)
+	buf.Write(packet.EphemeralKey[:])
+	buf.Write(packet.IdentityKey[:])
+	buf.Write(packet.Signature[:])
 	return buf.Bytes(), nil
 }
 
 func (packet *ConnectionAcceptedPacket) Decode(data []byte) error {
 	buf := bytes.NewBuffer(data)
 
-	err := checkPidAndLength(buf, ConnectionAcceptedPid, connectionAcceptedLength, false)
+	err := checkPidAndLength(buf, ConnectionAcceptedPid, connectionAcceptedLengthV0, true)
 	if err != nil {
 		return err
 	}
 
-	serverIdBytes, _ := buf.ReadBytes(8)
-	packet.ServerId = binary.BigEndian.Uint64(serverIdBytes)
+	packet.ServerId = binary.BigEndian.Uint64(buf.Next(8))
+
+	if buf.Len() == 0 {
+		return nil
+	}
+	packet.CompressionID, _ = buf.ReadByte()
+
+	if buf.Len() == 0 {
+		return nil
+	}
+	if buf.Len() < connectionAcceptedLength-connectionAcceptedLengthV1 {
+		return EncodeDecodeError{"incomplete handshake fields in ConnectionAcceptedPacket"}
+	}
+
+	copy(packet.EphemeralKey[:], buf.Next(x25519KeySize))
+	copy(packet.IdentityKey[:], buf.Next(ed25519PublicKeySize))
+	copy(packet.Signature[:], buf.Next(ed25519SignatureSize))
 
 	return nil
 }
@@ -128,6 +244,8 @@ const (
 	INCOMPATIBLE_PROTOCOL_VER ConnectionRejectedReason = iota
 	MAX_CONNECTIONS_REACHED
 	RATELIMITED
+	INCOMPATIBLE_COMPRESSION
+	UNAUTHORIZED_IDENTITY
 )
 
 func (packet *ConnectionRejectedPacket) Encode() ([]byte, error) {
@@ -219,6 +337,7 @@ func (packet *ChannelOpPacket) Encode() ([]byte, error) {
 	buf.Grow(channelOperationLength)
 
 	buf.WriteByte(byte(ChannelOperationPid))
+	buf.WriteByte(byte(packet.operation))
 	buf.WriteByte(packet.channel)
 
 	return buf.Bytes(), nil
@@ -232,6 +351,9 @@ func (packet *ChannelOpPacket) Decode(data []byte) error {
 		return err
 	}
 
+	operation, _ := buf.ReadByte()
+	packet.operation = ChannelOperation(operation)
+
 	channel, _ := buf.ReadByte()
 	packet.channel = channel
 
@@ -251,7 +373,99 @@ type ContainerPacket struct {
 	sequenceId uint32
 	// Only present if ordered is true
 	orderedId uint16
+	// Only present if reliable is false. Gives unreliable containers a
+	// unique-per-connection value to build AEAD nonces from, since they
+	// never receive a sequenceId.
+	unreliableCounter uint32
 
 	// Prefixed by a uint16 of length of payload
 	payload []byte
 }
+
+func (packet *ContainerPacket) flags() byte {
+	var flags byte
+
+	if packet.reliable {
+		flags |= containerReliableFlag
+	}
+	if packet.ordered {
+		flags |= containerOrderedFlag
+	}
+	if packet.compressed {
+		flags |= containerCompressedFlag
+	}
+
+	return flags
+}
+
+func (packet *ContainerPacket) Encode() ([]byte, error) {
+	if len(packet.payload) > 0xFFFF {
+		return nil, EncodeDecodeError{"payload exceeds maximum length of 65535 bytes"}
+	}
+
+	flags := packet.flags()
+
+	buf := bytes.Buffer{}
+	buf.Grow(containerExpectedLength(flags) + len(packet.payload))
+
+	buf.WriteByte(byte(ContainerPid))
+	buf.WriteByte(flags)
+	buf.WriteByte(packet.channel)
+
+	if packet.reliable {
+		WriteUInt32(&buf, packet.sequenceId)
+	} else {
+		WriteUInt32(&buf, packet.unreliableCounter)
+	}
+	if packet.ordered {
+		WriteUInt16(&buf, packet.orderedId)
+	}
+
+	WriteUInt16(&buf, uint16(len(packet.payload)))
+	buf.Write(packet.payload)
+
+	return buf.Bytes(), nil
+}
+
+func (packet *ContainerPacket) Decode(data []byte) error {
+	if len(data) < 2 {
+		return EncodeDecodeError{"Container packet too short to read flags"}
+	}
+
+	// Peek the flags byte (comes right after the packet ID) so the minimum
+	// expected length can be computed before handing off to checkPidAndLength.
+	expectedLength := containerExpectedLength(data[1])
+
+	buf := bytes.NewBuffer(data)
+	err := checkPidAndLength(buf, ContainerPid, expectedLength, true)
+	if err != nil {
+		return err
+	}
+
+	flags, _ := buf.ReadByte()
+	packet.reliable = flags&containerReliableFlag != 0
+	packet.ordered = flags&containerOrderedFlag != 0
+	packet.compressed = flags&containerCompressedFlag != 0
+
+	channel, _ := buf.ReadByte()
+	packet.channel = channel
+
+	if packet.reliable {
+		packet.sequenceId = binary.BigEndian.Uint32(buf.Next(4))
+	} else {
+		packet.unreliableCounter = binary.BigEndian.Uint32(buf.Next(4))
+	}
+	if packet.ordered {
+		packet.orderedId = binary.BigEndian.Uint16(buf.Next(2))
+	}
+
+	payloadLen := binary.BigEndian.Uint16(buf.Next(2))
+
+	if buf.Len() != int(payloadLen) {
+		return EncodeDecodeError{"Length of payload does not match prefix"}
+	}
+
+	packet.payload = buf.Bytes()
+
+	return nil
+}
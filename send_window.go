@@ -0,0 +1,159 @@
+package ojnet
+
+import (
+	"sync"
+	"time"
+)
+
+// RTO estimator gains from RFC 6298 (the Jacobson/Karels algorithm).
+const (
+	rttAlpha = 0.125
+	rttBeta  = 0.25
+
+	rtoRetransmitInterval = 50 * time.Millisecond
+	rtoBackoffCap         = 60 * time.Second
+)
+
+type pendingContainer struct {
+	data        []byte
+	sentAt      time.Time
+	retransmits int
+}
+
+// SendWindow tracks outstanding reliable containers for a Connection and
+// retransmits them once their retransmission timeout (RTO) elapses. The RTO
+// is derived from a smoothed round-trip-time estimate (SRTT) and its
+// variance (RTTVAR), backing off once per scan that retransmits anything.
+type SendWindow struct {
+	conn *Connection
+
+	lock    sync.Mutex
+	pending map[uint32]*pendingContainer
+
+	haveMeasurement bool
+	srtt            time.Duration
+	rttvar          time.Duration
+	rto             time.Duration
+
+	ticker   *time.Ticker
+	stopChan chan struct{}
+}
+
+func NewSendWindow(conn *Connection) *SendWindow {
+	return &SendWindow{
+		conn:     conn,
+		pending:  make(map[uint32]*pendingContainer),
+		rto:      initialRTO,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// track begins tracking a reliable container for retransmission.
+func (w *SendWindow) track(sequenceId uint32, data []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.pending[sequenceId] = &pendingContainer{data: data, sentAt: time.Now()}
+}
+
+// ack marks the given sequence IDs as acknowledged, feeding any first-try
+// deliveries into the RTT estimator.
+func (w *SendWindow) ack(sequenceIds []uint32) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for _, id := range sequenceIds {
+		pc, ok := w.pending[id]
+		if !ok {
+			continue
+		}
+		delete(w.pending, id)
+
+		// Karn's algorithm: a retransmitted container's RTT is ambiguous
+		// (the ack may be for the original or the retransmit), so only
+		// first-try deliveries feed the estimator.
+		if pc.retransmits == 0 {
+			w.sample(time.Since(pc.sentAt))
+		}
+	}
+}
+
+// sample feeds a fresh round-trip-time measurement into the SRTT/RTTVAR
+// estimator and recomputes the RTO, per RFC 6298.
+func (w *SendWindow) sample(rtt time.Duration) {
+	if !w.haveMeasurement {
+		w.srtt = rtt
+		w.rttvar = rtt / 2
+		w.haveMeasurement = true
+	} else {
+		diff := w.srtt - rtt
+		if diff < 0 {
+			diff = -diff
+		}
+		w.rttvar = time.Duration(float64(w.rttvar)*(1-rttBeta) + float64(diff)*rttBeta)
+		w.srtt = time.Duration(float64(w.srtt)*(1-rttAlpha) + float64(rtt)*rttAlpha)
+	}
+
+	w.rto = w.srtt + 4*w.rttvar
+	if w.rto < minRTO {
+		w.rto = minRTO
+	}
+}
+
+// run periodically scans for containers past their RTO and retransmits
+// them, doubling the RTO once per scan with any loss, up to rtoBackoffCap.
+func (w *SendWindow) run() {
+	w.ticker = time.NewTicker(rtoRetransmitInterval)
+	defer w.ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopChan:
+			return
+		case <-w.ticker.C:
+			w.retransmitExpired()
+		}
+	}
+}
+
+func (w *SendWindow) retransmitExpired() {
+	w.lock.Lock()
+	now := time.Now()
+	rto := w.rto
+
+	var toSend [][]byte
+	var lost bool
+	for _, pc := range w.pending {
+		if now.Sub(pc.sentAt) < rto {
+			continue
+		}
+
+		pc.sentAt = now
+		pc.retransmits++
+		toSend = append(toSend, pc.data)
+		lost = true
+	}
+
+	// Back off the RTO at most once per scan: a burst of containers
+	// expiring together is one loss event, not one per container.
+	if lost {
+		backoff := w.rto * 2
+		if backoff > rtoBackoffCap {
+			backoff = rtoBackoffCap
+		}
+		w.rto = backoff
+	}
+	w.lock.Unlock()
+
+	for _, data := range toSend {
+		w.conn.writeToPeer(data)
+	}
+}
+
+func (w *SendWindow) stop() {
+	select {
+	case <-w.stopChan:
+	default:
+		close(w.stopChan)
+	}
+}
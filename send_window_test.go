@@ -0,0 +1,68 @@
+package ojnet
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSendWindowSampleConvergesRTO(t *testing.T) {
+	w := NewSendWindow(nil)
+
+	for i := 0; i < 20; i++ {
+		w.sample(100 * time.Millisecond)
+	}
+
+	if w.srtt < 90*time.Millisecond || w.srtt > 110*time.Millisecond {
+		t.Fatalf("srtt = %v, want ~100ms after convergence", w.srtt)
+	}
+	if w.rto < minRTO {
+		t.Fatalf("rto = %v, should never drop below minRTO (%v)", w.rto, minRTO)
+	}
+}
+
+func TestSendWindowAckOnlySamplesFirstTryDeliveries(t *testing.T) {
+	w := NewSendWindow(nil)
+	w.track(1, []byte("data"))
+
+	pc := w.pending[1]
+	pc.retransmits = 1
+	pc.sentAt = time.Now().Add(-time.Second)
+
+	w.ack([]uint32{1})
+
+	if w.haveMeasurement {
+		t.Fatal("retransmitted container's ack must not feed the RTT estimator (Karn's algorithm)")
+	}
+	if _, stillPending := w.pending[1]; stillPending {
+		t.Fatal("acked container should be removed from the pending set")
+	}
+}
+
+func TestSendWindowRetransmitExpiredBacksOffOncePerScan(t *testing.T) {
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.ListenPacket() returned error: %v", err)
+	}
+	defer packetConn.Close()
+
+	conn := &Connection{conn: packetConn, peer: packetConn.LocalAddr()}
+	w := NewSendWindow(conn)
+
+	startRTO := w.rto
+	expired := time.Now().Add(-time.Second)
+	for id := uint32(1); id <= 5; id++ {
+		w.track(id, []byte("data"))
+		w.pending[id].sentAt = expired
+	}
+
+	w.retransmitExpired()
+
+	want := startRTO * 2
+	if want > rtoBackoffCap {
+		want = rtoBackoffCap
+	}
+	if w.rto != want {
+		t.Fatalf("rto after one scan with 5 simultaneous losses = %v, want %v (backoff applied once, not 2^5)", w.rto, want)
+	}
+}